@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	server "github.com/em-zhang/dynamodb-server"
+	"github.com/sirupsen/logrus"
+)
+
+func main() {
+	// Instantiate server object
+	srv := server.Server{} // referencing server.go file
+
+	enviro := os.Getenv("ENVIRONMENT")
+	if enviro == "" {
+		enviro = "dev" // Default to dev environment
+	}
+
+	// == AWS Config ==
+	// talking to local dynamoDB container, need it for actual AWS instance as well
+	ctx := context.Background()
+	var cfg aws.Config
+	var aerr error
+	if enviro == "dev" {
+		cfg, aerr = config.LoadDefaultConfig(ctx,
+			config.WithRegion("us-west-2"),
+			config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider("empty", "empty", "")),
+		)
+	} else {
+		cfg, aerr = config.LoadDefaultConfig(ctx)
+	}
+
+	if aerr != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": aerr.Error(),
+		}).Fatal("unable to load AWS config")
+	}
+
+	srv.Client = dynamodb.NewFromConfig(cfg, func(o *dynamodb.Options) {
+		if enviro == "dev" {
+			o.BaseEndpoint = aws.String("http://localhost:8000")
+		}
+	})
+
+	http.HandleFunc("/list", srv.ListHandler)
+	http.HandleFunc("/deactivate", srv.DeactivateHandler)
+	http.HandleFunc("/items", srv.PutItemHandler)
+	http.HandleFunc("/items/", srv.ItemHandler)
+	http.HandleFunc("/tables", srv.TablesHandler)
+
+	fmt.Printf("\nStarting server at port 8000\n")
+	http.ListenAndServe(":8000", nil)
+
+	if err := http.ListenAndServe(":8080", nil); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,437 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/sirupsen/logrus"
+)
+
+// CreateTableRequest describes the body accepted by CreateTableHandler.
+// PartitionKey is required; SortKey is optional, for tables with a
+// composite key. Both are omitted by existing callers, who get
+// defaultKeySchema (a binary "index" partition key) so they keep working
+// unchanged.
+type CreateTableRequest struct {
+	TableName    string
+	PartitionKey KeyDefinition
+	SortKey      *KeyDefinition
+}
+
+// ItemHandler dispatches /items/{index} requests by method to the
+// appropriate typed handler.
+func (s *Server) ItemHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		s.GetItemHandler(w, r)
+	case "PATCH":
+		s.UpdateItemHandler(w, r)
+	case "DELETE":
+		s.DeleteItemHandler(w, r)
+	default:
+		http.Error(w, "404 not found, method not supported.", http.StatusNotFound)
+	}
+}
+
+// TablesHandler dispatches /tables requests by method to the appropriate
+// typed handler.
+func (s *Server) TablesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		s.ListTablesHandler(w, r)
+	case "POST":
+		s.CreateTableHandler(w, r)
+	default:
+		http.Error(w, "404 not found, method not supported.", http.StatusNotFound)
+	}
+}
+
+// PutItemHandler creates or replaces an item via the /items endpoint. The
+// item's key is built from tableName's registered KeySchema (falling back
+// to the legacy binary "index" key), the same way GetItemHandler/
+// UpdateItemHandler/DeleteItemHandler build theirs, instead of assuming
+// the fixed Item struct's Index field — so tables registered with a
+// string or composite key can be written to as well.
+func (s *Server) PutItemHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/items" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "404 not found, method not supported.", http.StatusNotFound)
+		return
+	}
+
+	ctx := r.Context()
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to read PutItem request body")
+		http.Error(w, "400 bad request.", http.StatusBadRequest)
+		return
+	}
+
+	item := map[string]interface{}{}
+	if err := json.Unmarshal(body, &item); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to unmarshal PutItem request body")
+		http.Error(w, "400 bad request.", http.StatusBadRequest)
+		return
+	}
+
+	tableName := r.URL.Query().Get("tableName")
+	schema := s.schemaFor(tableName)
+
+	keyValues, err := putItemKeyValues(schema, item)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to read key values from PutItem request body")
+		http.Error(w, fmt.Sprintf("400 bad request: %s.", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	key, err := s.buildKey(tableName, keyValues)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to build key for PutItem")
+		http.Error(w, "400 bad request.", http.StatusBadRequest)
+		return
+	}
+
+	av, err := attributevalue.MarshalMap(item)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to marshal item for PutItem")
+		http.Error(w, "500 internal server error.", http.StatusInternalServerError)
+		return
+	}
+	for name, value := range key {
+		av[name] = value
+	}
+
+	_, err = s.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(tableName),
+		Item:      av,
+	})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to call PutItem")
+		http.Error(w, "500 internal server error.", http.StatusInternalServerError)
+		return
+	}
+
+	respJSON, err := json.MarshalIndent(item, "", "    ")
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Got error marshalling PutItem response")
+		return
+	}
+	w.Write(respJSON)
+}
+
+// putItemKeyValues reads schema's key attributes out of a PutItem request
+// body as raw strings, the same form buildKey expects from GetItemHandler/
+// UpdateItemHandler/DeleteItemHandler's path- and query-sourced key values.
+func putItemKeyValues(schema KeySchema, item map[string]interface{}) (map[string]string, error) {
+	values := map[string]string{}
+
+	pv, ok := item[schema.PartitionKey.Name]
+	if !ok {
+		return nil, fmt.Errorf("missing partition key %q", schema.PartitionKey.Name)
+	}
+	values[schema.PartitionKey.Name] = fmt.Sprintf("%v", pv)
+
+	if schema.SortKey != nil {
+		sv, ok := item[schema.SortKey.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing sort key %q", schema.SortKey.Name)
+		}
+		values[schema.SortKey.Name] = fmt.Sprintf("%v", sv)
+	}
+
+	return values, nil
+}
+
+// GetItemHandler returns a single item by index via the /items/{index} endpoint
+func (s *Server) GetItemHandler(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/items/") {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "404 not found, method not supported.", http.StatusNotFound)
+		return
+	}
+
+	index := strings.TrimPrefix(r.URL.Path, "/items/")
+	tableName := r.URL.Query().Get("tableName")
+
+	item, err := s.DynamoDBGetItem(r.Context(), getItemParams{tableName: tableName, keyValues: s.pathKeyValues(tableName, index, r)})
+	if err != nil {
+		http.Error(w, "500 internal server error.", http.StatusInternalServerError)
+		return
+	}
+
+	respJSON, err := json.MarshalIndent(item, "", "    ")
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Got error marshalling GetItem response")
+		return
+	}
+	w.Write(respJSON)
+}
+
+// UpdateItemHandler applies a partial update to an item via the /items/{index} endpoint
+func (s *Server) UpdateItemHandler(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/items/") {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+	if r.Method != "PATCH" {
+		http.Error(w, "404 not found, method not supported.", http.StatusNotFound)
+		return
+	}
+
+	ctx := r.Context()
+	index := strings.TrimPrefix(r.URL.Path, "/items/")
+	tableName := r.URL.Query().Get("tableName")
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to read UpdateItem request body")
+		http.Error(w, "400 bad request.", http.StatusBadRequest)
+		return
+	}
+
+	updates := map[string]interface{}{}
+	if err := json.Unmarshal(body, &updates); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to unmarshal UpdateItem request body")
+		http.Error(w, "400 bad request.", http.StatusBadRequest)
+		return
+	}
+
+	av, err := attributevalue.MarshalMap(updates)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to marshal updates for UpdateItem")
+		http.Error(w, "500 internal server error.", http.StatusInternalServerError)
+		return
+	}
+
+	schema := s.schemaFor(tableName)
+	key, err := s.buildKey(tableName, s.pathKeyValues(tableName, index, r))
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to build key for UpdateItem")
+		http.Error(w, "400 bad request.", http.StatusBadRequest)
+		return
+	}
+
+	updateExpr := "set"
+	exprNames := map[string]string{}
+	exprValues := map[string]types.AttributeValue{}
+	i := 0
+	for name, value := range av {
+		if name == schema.PartitionKey.Name || (schema.SortKey != nil && name == schema.SortKey.Name) {
+			continue
+		}
+		placeholder := fmt.Sprintf("#u%d", i)
+		valuePlaceholder := fmt.Sprintf(":u%d", i)
+		if i > 0 {
+			updateExpr += ","
+		}
+		updateExpr += " " + placeholder + " = " + valuePlaceholder
+		exprNames[placeholder] = name
+		exprValues[valuePlaceholder] = value
+		i++
+	}
+	if i == 0 {
+		http.Error(w, "400 bad request: no updatable fields in request body.", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := s.Client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(tableName),
+		Key:                       key,
+		ExpressionAttributeNames:  exprNames,
+		ExpressionAttributeValues: exprValues,
+		UpdateExpression:          aws.String(updateExpr),
+		ReturnValues:              types.ReturnValueAllNew,
+	})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to call UpdateItem")
+		http.Error(w, "500 internal server error.", http.StatusInternalServerError)
+		return
+	}
+
+	item := Item{}
+	if err := attributevalue.UnmarshalMap(resp.Attributes, &item); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to unmarshal UpdateItem response")
+		return
+	}
+
+	respJSON, err := json.MarshalIndent(item, "", "    ")
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Got error marshalling UpdateItem response")
+		return
+	}
+	w.Write(respJSON)
+}
+
+// DeleteItemHandler removes an item by index via the /items/{index} endpoint
+func (s *Server) DeleteItemHandler(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/items/") {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+	if r.Method != "DELETE" {
+		http.Error(w, "404 not found, method not supported.", http.StatusNotFound)
+		return
+	}
+
+	index := strings.TrimPrefix(r.URL.Path, "/items/")
+	tableName := r.URL.Query().Get("tableName")
+
+	key, err := s.buildKey(tableName, s.pathKeyValues(tableName, index, r))
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to build key for DeleteItem")
+		http.Error(w, "400 bad request.", http.StatusBadRequest)
+		return
+	}
+
+	_, err = s.Client.DeleteItem(r.Context(), &dynamodb.DeleteItemInput{
+		TableName: aws.String(tableName),
+		Key:       key,
+	})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to call DeleteItem")
+		http.Error(w, "500 internal server error.", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// CreateTableHandler bootstraps a new table via the /tables endpoint
+func (s *Server) CreateTableHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/tables" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "404 not found, method not supported.", http.StatusNotFound)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to read CreateTable request body")
+		http.Error(w, "400 bad request.", http.StatusBadRequest)
+		return
+	}
+
+	req := CreateTableRequest{}
+	if err := json.Unmarshal(body, &req); err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to unmarshal CreateTable request body")
+		http.Error(w, "400 bad request.", http.StatusBadRequest)
+		return
+	}
+
+	schema := KeySchema{PartitionKey: req.PartitionKey, SortKey: req.SortKey}
+	if schema.PartitionKey.Name == "" {
+		schema = defaultKeySchema
+	}
+
+	attrDefs, keyElems, err := tableKeyDefinitions(schema)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Invalid key schema for CreateTable")
+		http.Error(w, fmt.Sprintf("400 bad request: %s.", err.Error()), http.StatusBadRequest)
+		return
+	}
+
+	_, err = s.Client.CreateTable(r.Context(), &dynamodb.CreateTableInput{
+		TableName:            aws.String(req.TableName),
+		AttributeDefinitions: attrDefs,
+		KeySchema:            keyElems,
+		BillingMode:          types.BillingModePayPerRequest,
+	})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to call CreateTable")
+		http.Error(w, "500 internal server error.", http.StatusInternalServerError)
+		return
+	}
+
+	s.RegisterTable(req.TableName, schema)
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// ListTablesHandler lists the tables available in the account via the /tables endpoint
+func (s *Server) ListTablesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/tables" {
+		http.Error(w, "404 not found.", http.StatusNotFound)
+		return
+	}
+	if r.Method != "GET" {
+		http.Error(w, "404 not found, method not supported.", http.StatusNotFound)
+		return
+	}
+
+	result, err := s.Client.ListTables(r.Context(), &dynamodb.ListTablesInput{})
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to call ListTables")
+		http.Error(w, "500 internal server error.", http.StatusInternalServerError)
+		return
+	}
+
+	respJSON, err := json.MarshalIndent(result.TableNames, "", "    ")
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Got error marshalling ListTables response")
+		return
+	}
+	w.Write(respJSON)
+}
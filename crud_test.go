@@ -0,0 +1,136 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// capturingDynamoDBClient records the last PutItem/UpdateItem input it saw,
+// so handler tests can assert on the request DynamoDB would actually get.
+type capturingDynamoDBClient struct {
+	fakeDynamoDBClient
+	lastPutItem    *dynamodb.PutItemInput
+	lastUpdateItem *dynamodb.UpdateItemInput
+}
+
+func (c *capturingDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	c.lastPutItem = params
+	return c.fakeDynamoDBClient.PutItem(ctx, params, optFns...)
+}
+
+func (c *capturingDynamoDBClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	c.lastUpdateItem = params
+	return c.fakeDynamoDBClient.UpdateItem(ctx, params, optFns...)
+}
+
+// TestCreateTableHandlerRegistersCustomKeySchema guards against
+// RegisterTable going uncalled: a table created with a non-default
+// PartitionKey must be retrievable via schemaFor so later Get/Put/Update
+// requests build the right kind of key.
+func TestCreateTableHandlerRegistersCustomKeySchema(t *testing.T) {
+	s := &Server{Client: &fakeDynamoDBClient{}}
+
+	body := `{"TableName":"users","PartitionKey":{"Name":"id","Type":"S"}}`
+	req := httptest.NewRequest(http.MethodPost, "/tables", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	s.CreateTableHandler(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body.String())
+	}
+
+	got := s.schemaFor("users")
+	if got.PartitionKey.Name != "id" || got.PartitionKey.Type != AttributeTypeString {
+		t.Fatalf("expected registered schema with partition key \"id\"/S, got %+v", got)
+	}
+}
+
+// TestPutItemHandlerUsesRegisteredKeySchema guards against PutItemHandler
+// only ever being able to write the legacy binary "index" key: a table
+// registered with a string partition key must accept a put whose key is
+// under that attribute name, marshaled as S rather than B.
+func TestPutItemHandlerUsesRegisteredKeySchema(t *testing.T) {
+	client := &capturingDynamoDBClient{}
+	s := &Server{Client: client}
+	s.RegisterTable("users", KeySchema{PartitionKey: KeyDefinition{Name: "id", Type: AttributeTypeString}})
+
+	body := `{"id":"uuid-1","name":"Ada"}`
+	req := httptest.NewRequest(http.MethodPost, "/items?tableName=users", bytes.NewBufferString(body))
+	w := httptest.NewRecorder()
+	s.PutItemHandler(w, req)
+
+	if w.Code != http.StatusOK && w.Code != 0 {
+		t.Fatalf("expected success, got %d: %s", w.Code, w.Body.String())
+	}
+	if client.lastPutItem == nil {
+		t.Fatal("expected PutItem to be called")
+	}
+	idAttr, ok := client.lastPutItem.Item["id"].(*types.AttributeValueMemberS)
+	if !ok {
+		t.Fatalf("expected \"id\" to be a string attribute, got %T", client.lastPutItem.Item["id"])
+	}
+	if idAttr.Value != "uuid-1" {
+		t.Fatalf("expected id %q, got %q", "uuid-1", idAttr.Value)
+	}
+}
+
+// TestUpdateItemHandlerRejectsEmptyBody guards against UpdateItemHandler
+// sending DynamoDB a syntactically invalid "set" UpdateExpression (no
+// clauses) when the PATCH body has no non-key fields to update.
+func TestUpdateItemHandlerRejectsEmptyBody(t *testing.T) {
+	s := &Server{Client: &fakeDynamoDBClient{}}
+
+	req := httptest.NewRequest(http.MethodPatch, "/items/abc?tableName=table-a", bytes.NewBufferString(`{}`))
+	w := httptest.NewRecorder()
+	s.UpdateItemHandler(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 for an update with no updatable fields, got %d", w.Code)
+	}
+}
+
+// TestUpdateItemHandlerManyFieldsUsesNumericPlaceholders guards against the
+// expression-attribute-name placeholder generator producing non-alphanumeric
+// runes once a PATCH body has more than 26 non-key fields.
+func TestUpdateItemHandlerManyFieldsUsesNumericPlaceholders(t *testing.T) {
+	client := &capturingDynamoDBClient{}
+	s := &Server{Client: client}
+
+	fields := map[string]string{}
+	for i := 0; i < 30; i++ {
+		fields[fmt.Sprintf("field%d", i)] = fmt.Sprintf("value%d", i)
+	}
+	body, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatalf("failed to build request body: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodPatch, "/items/abc?tableName=table-a", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	s.UpdateItemHandler(w, req)
+
+	if w.Code != http.StatusOK && w.Code != 0 {
+		t.Fatalf("expected success, got %d: %s", w.Code, w.Body.String())
+	}
+	if client.lastUpdateItem == nil {
+		t.Fatal("expected UpdateItem to be called")
+	}
+	for placeholder := range client.lastUpdateItem.ExpressionAttributeNames {
+		for _, r := range placeholder {
+			if r == '#' {
+				continue
+			}
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+				t.Fatalf("placeholder %q contains a non-alphanumeric rune %q", placeholder, r)
+			}
+		}
+	}
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// AttributeType mirrors the DynamoDB scalar attribute types a key can use.
+type AttributeType string
+
+const (
+	AttributeTypeString AttributeType = "S"
+	AttributeTypeNumber AttributeType = "N"
+	AttributeTypeBinary AttributeType = "B"
+)
+
+// KeyDefinition names one attribute of a table's primary key and its type.
+type KeyDefinition struct {
+	Name string
+	Type AttributeType
+}
+
+// KeySchema describes a table's primary key: a required partition key and
+// an optional sort key, for tables with a composite key.
+type KeySchema struct {
+	PartitionKey KeyDefinition
+	SortKey      *KeyDefinition
+}
+
+// defaultKeySchema matches the table shape this server assumed before
+// RegisterTable existed: a single binary attribute named "index".
+var defaultKeySchema = KeySchema{
+	PartitionKey: KeyDefinition{Name: "index", Type: AttributeTypeBinary},
+}
+
+// RegisterTable records the primary-key shape for tableName, so
+// DynamoDBGetItem and DynamoDBDeactivate can build keys for it from raw
+// string values instead of assuming a binary "index" attribute. Tables that
+// are never registered fall back to that legacy default.
+func (s *Server) RegisterTable(tableName string, schema KeySchema) {
+	s.schemasMu.Lock()
+	defer s.schemasMu.Unlock()
+	if s.tableSchemas == nil {
+		s.tableSchemas = map[string]KeySchema{}
+	}
+	s.tableSchemas[tableName] = schema
+}
+
+// schemaFor returns the registered KeySchema for tableName, or
+// defaultKeySchema if none was registered.
+func (s *Server) schemaFor(tableName string) KeySchema {
+	s.schemasMu.RLock()
+	defer s.schemasMu.RUnlock()
+	if schema, ok := s.tableSchemas[tableName]; ok {
+		return schema
+	}
+	return defaultKeySchema
+}
+
+// buildKey converts raw string values, keyed by attribute name, into a
+// DynamoDB key map for tableName's registered KeySchema.
+func (s *Server) buildKey(tableName string, values map[string]string) (map[string]types.AttributeValue, error) {
+	schema := s.schemaFor(tableName)
+
+	key := map[string]types.AttributeValue{}
+
+	pv, ok := values[schema.PartitionKey.Name]
+	if !ok {
+		return nil, fmt.Errorf("missing partition key %q", schema.PartitionKey.Name)
+	}
+	av, err := attributeValueFor(schema.PartitionKey, pv)
+	if err != nil {
+		return nil, err
+	}
+	key[schema.PartitionKey.Name] = av
+
+	if schema.SortKey != nil {
+		sv, ok := values[schema.SortKey.Name]
+		if !ok {
+			return nil, fmt.Errorf("missing sort key %q", schema.SortKey.Name)
+		}
+		av, err := attributeValueFor(*schema.SortKey, sv)
+		if err != nil {
+			return nil, err
+		}
+		key[schema.SortKey.Name] = av
+	}
+
+	return key, nil
+}
+
+// pathKeyValues maps a single /items/{index} path value onto tableName's
+// registered KeySchema: the path value becomes the partition key, and an
+// optional sortKey query param fills a composite sort key.
+func (s *Server) pathKeyValues(tableName, pathValue string, r *http.Request) map[string]string {
+	schema := s.schemaFor(tableName)
+	values := map[string]string{schema.PartitionKey.Name: pathValue}
+	if schema.SortKey != nil {
+		values[schema.SortKey.Name] = r.URL.Query().Get("sortKey")
+	}
+	return values
+}
+
+// attributeValueFor encodes raw as the AttributeValue variant kd.Type calls for.
+func attributeValueFor(kd KeyDefinition, raw string) (types.AttributeValue, error) {
+	switch kd.Type {
+	case AttributeTypeString:
+		return &types.AttributeValueMemberS{Value: raw}, nil
+	case AttributeTypeNumber:
+		return &types.AttributeValueMemberN{Value: raw}, nil
+	case AttributeTypeBinary:
+		return &types.AttributeValueMemberB{Value: []byte(raw)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key attribute type %q", kd.Type)
+	}
+}
+
+// scalarAttributeType maps a KeyDefinition's AttributeType onto the
+// dynamodb.types.ScalarAttributeType CreateTableInput's AttributeDefinitions
+// expect.
+func scalarAttributeType(t AttributeType) (types.ScalarAttributeType, error) {
+	switch t {
+	case AttributeTypeString:
+		return types.ScalarAttributeTypeS, nil
+	case AttributeTypeNumber:
+		return types.ScalarAttributeTypeN, nil
+	case AttributeTypeBinary:
+		return types.ScalarAttributeTypeB, nil
+	default:
+		return "", fmt.Errorf("unsupported key attribute type %q", t)
+	}
+}
+
+// tableKeyDefinitions converts a KeySchema into the AttributeDefinitions and
+// KeySchema CreateTableInput expects, so CreateTableHandler can bootstrap a
+// table with any registered key shape instead of a hardcoded binary "index".
+func tableKeyDefinitions(schema KeySchema) ([]types.AttributeDefinition, []types.KeySchemaElement, error) {
+	pkType, err := scalarAttributeType(schema.PartitionKey.Type)
+	if err != nil {
+		return nil, nil, err
+	}
+	attrDefs := []types.AttributeDefinition{
+		{AttributeName: aws.String(schema.PartitionKey.Name), AttributeType: pkType},
+	}
+	keyElems := []types.KeySchemaElement{
+		{AttributeName: aws.String(schema.PartitionKey.Name), KeyType: types.KeyTypeHash},
+	}
+
+	if schema.SortKey != nil {
+		skType, err := scalarAttributeType(schema.SortKey.Type)
+		if err != nil {
+			return nil, nil, err
+		}
+		attrDefs = append(attrDefs, types.AttributeDefinition{AttributeName: aws.String(schema.SortKey.Name), AttributeType: skType})
+		keyElems = append(keyElems, types.KeySchemaElement{AttributeName: aws.String(schema.SortKey.Name), KeyType: types.KeyTypeRange})
+	}
+
+	return attrDefs, keyElems, nil
+}
@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/sirupsen/logrus"
+)
+
+// ListResponse is the JSON body returned by ListHandler. LastEvaluatedKey is
+// an opaque cursor: pass it back as the startKey query param to fetch the
+// next page, and it's empty once the scan is exhausted.
+type ListResponse struct {
+	Items            []Item `json:"items"`
+	LastEvaluatedKey string `json:"lastEvaluatedKey,omitempty"`
+}
+
+// parseLimit converts the limit query param into a Scan/Query Limit. An
+// empty string means "no limit".
+func parseLimit(raw string) (int32, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	limit, err := strconv.ParseInt(raw, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	return int32(limit), nil
+}
+
+// keyAttr is the wire format encodeStartKey/decodeStartKey use for a single
+// key attribute. Unlike routing the value through attributevalue into a
+// generic map[string]interface{}, keeping B as a []byte field lets
+// encoding/json base64-encode and decode it back to a []byte, instead of a
+// plain string that would re-marshal as attribute type S. Keys only ever
+// use S, N, or B (see AttributeType), so that's all this needs to cover.
+type keyAttr struct {
+	S *string `json:"S,omitempty"`
+	N *string `json:"N,omitempty"`
+	B []byte  `json:"B,omitempty"`
+}
+
+// encodeStartKey turns a DynamoDB key into the opaque cursor string clients
+// round-trip through the startKey query param.
+func encodeStartKey(key map[string]types.AttributeValue) (string, error) {
+	if len(key) == 0 {
+		return "", nil
+	}
+	wire := make(map[string]keyAttr, len(key))
+	for name, av := range key {
+		switch v := av.(type) {
+		case *types.AttributeValueMemberS:
+			wire[name] = keyAttr{S: &v.Value}
+		case *types.AttributeValueMemberN:
+			wire[name] = keyAttr{N: &v.Value}
+		case *types.AttributeValueMemberB:
+			wire[name] = keyAttr{B: v.Value}
+		default:
+			return "", fmt.Errorf("unsupported key attribute type for %q: %T", name, av)
+		}
+	}
+	raw, err := json.Marshal(wire)
+	if err != nil {
+		return "", err
+	}
+	return base64.URLEncoding.EncodeToString(raw), nil
+}
+
+// decodeStartKey is the inverse of encodeStartKey.
+func decodeStartKey(cursor string) (map[string]types.AttributeValue, error) {
+	if cursor == "" {
+		return nil, nil
+	}
+	raw, err := base64.URLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	var wire map[string]keyAttr
+	if err := json.Unmarshal(raw, &wire); err != nil {
+		return nil, err
+	}
+	key := make(map[string]types.AttributeValue, len(wire))
+	for name, attr := range wire {
+		switch {
+		case attr.S != nil:
+			key[name] = &types.AttributeValueMemberS{Value: *attr.S}
+		case attr.N != nil:
+			key[name] = &types.AttributeValueMemberN{Value: *attr.N}
+		case attr.B != nil:
+			key[name] = &types.AttributeValueMemberB{Value: attr.B}
+		default:
+			return nil, fmt.Errorf("key attribute %q has no recognized value", name)
+		}
+	}
+	return key, nil
+}
+
+// streamList scans tableName one page at a time via the Scan paginator and
+// writes each item to w as it arrives, so callers never have to buffer the
+// whole table in memory. It requires an http.Flusher to push pages to the
+// client as they're read.
+func (s *Server) streamList(ctx context.Context, w http.ResponseWriter, tableName string) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "500 internal server error: streaming unsupported.", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, "[")
+	flusher.Flush()
+
+	paginator := dynamodb.NewScanPaginator(s.Client, &dynamodb.ScanInput{
+		TableName: aws.String(tableName),
+	})
+
+	first := true
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Error("Failed to scan page while streaming DynamoDB")
+			break
+		}
+
+		items := []Item{}
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &items); err != nil {
+			logrus.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Error("Failed to unmarshal DynamoDB page while streaming")
+			break
+		}
+
+		for _, item := range items {
+			if !first {
+				fmt.Fprint(w, ",")
+			}
+			first = false
+			itemJSON, err := json.Marshal(item)
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error": err.Error(),
+				}).Error("Failed to marshal item while streaming")
+				continue
+			}
+			w.Write(itemJSON)
+		}
+		flusher.Flush()
+	}
+
+	fmt.Fprint(w, "]")
+	flusher.Flush()
+}
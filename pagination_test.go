@@ -0,0 +1,34 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// TestEncodeDecodeStartKeyRoundTripsBinary guards against the cursor
+// round-trip silently turning a binary key attribute into a string one,
+// which breaks pagination on the default binary "index" key schema.
+func TestEncodeDecodeStartKeyRoundTripsBinary(t *testing.T) {
+	key := map[string]types.AttributeValue{
+		"index": &types.AttributeValueMemberB{Value: []byte("abc123")},
+	}
+
+	cursor, err := encodeStartKey(key)
+	if err != nil {
+		t.Fatalf("encodeStartKey returned error: %v", err)
+	}
+
+	decoded, err := decodeStartKey(cursor)
+	if err != nil {
+		t.Fatalf("decodeStartKey returned error: %v", err)
+	}
+
+	got, ok := decoded["index"].(*types.AttributeValueMemberB)
+	if !ok {
+		t.Fatalf("expected index to decode back to a binary attribute, got %T", decoded["index"])
+	}
+	if string(got.Value) != "abc123" {
+		t.Fatalf("expected decoded value %q, got %q", "abc123", got.Value)
+	}
+}
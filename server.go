@@ -2,16 +2,20 @@
 package server
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/dynamodb"
-	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbattribute"
-	"github.com/aws/aws-sdk-go/service/dynamodb/expression"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/expression"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 	"github.com/sirupsen/logrus"
 )
 
@@ -21,65 +25,126 @@ type Request struct {
 	Action  string
 }
 
-// Server provides shared resources for all calls to the server.
+// DynamoDBAPI is the subset of *dynamodb.Client that Server depends on. It
+// lets tests inject a fake client instead of talking to a real table.
+type DynamoDBAPI interface {
+	Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error)
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error)
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error)
+	DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error)
+	CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error)
+	ListTables(ctx context.Context, params *dynamodb.ListTablesInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTablesOutput, error)
+}
+
+// Server provides shared resources for all calls to the server. It holds no
+// per-request state: handlers run concurrently on the same *Server, so any
+// request parameters must stay local to the handler goroutine.
 type Server struct {
-	Name  string
-	ASess *session.Session
+	Name   string
+	Client DynamoDBAPI
+
+	// tableSchemas maps a table name to its registered KeySchema, set up
+	// via RegisterTable and read on every request, so it's guarded by its
+	// own mutex.
+	schemasMu    sync.RWMutex
+	tableSchemas map[string]KeySchema
+}
 
-	// Params passed in through request
+// Item is a direct map of the entity in the dynamoDB table. The
+// dynamodbav tags keep the marshaled attribute names lowercase, matching
+// the attribute names CreateTableHandler and DynamoDBQuery already assume
+// (e.g. the "index" partition key) instead of the capitalized Go field
+// names attributevalue.MarshalMap would otherwise produce.
+type Item struct {
+	Index   []byte   `dynamodbav:"index"`
+	Name    string   `dynamodbav:"name"`
+	Users   []string `dynamodbav:"users"`
+	Active  bool     `dynamodbav:"active"`
+	Version int64    `dynamodbav:"version"`
+}
+
+// listParams holds the per-request parameters for DynamoDBList.
+type listParams struct {
+	tableName string
+	limit     int32
+	startKey  map[string]types.AttributeValue
+}
+
+// queryParams holds the per-request parameters for DynamoDBQuery.
+type queryParams struct {
 	tableName string
 	name      string
 	status    string // active or inactive
 	active    bool   // true or false
-	index []byte
+	limit     int32
+	startKey  map[string]types.AttributeValue
 }
 
-// Entry is a direct map of the entity in the dynamoDB table
-type Item struct {
-	Index   []byte
-	Name          string
-	Users []string
-	Active      bool
+// getItemParams holds the per-request parameters for DynamoDBGetItem.
+// keyValues holds the raw, unencoded key attribute values keyed by
+// attribute name, as named by the table's registered KeySchema.
+type getItemParams struct {
+	tableName string
+	keyValues map[string]string
+}
+
+// deactivateParams holds the per-request parameters for DynamoDBDeactivate.
+// expectedVersion, when non-nil, adds a version = expectedVersion condition
+// to the update so a stale caller's deactivate is rejected instead of
+// clobbering a newer write (optimistic concurrency via If-Match).
+type deactivateParams struct {
+	tableName       string
+	keyValues       map[string]string
+	expectedVersion *int64
 }
 
-// DynamoDBList returns all contents of table as json
-func (s *Server) DynamoDBList(dynamoDBClient *dynamodb.DynamoDB) (contents []Item, dynamoError error) {
+// DynamoDBList returns a page of the table's contents. The returned
+// lastEvaluatedKey is non-nil when more pages remain; pass it back as
+// listParams.startKey to resume from there.
+func (s *Server) DynamoDBList(ctx context.Context, p listParams) (contents []Item, lastEvaluatedKey map[string]types.AttributeValue, dynamoError error) {
 	// Scan dynamodb client by requested table name
 	input := &dynamodb.ScanInput{
-		TableName: aws.String(s.tableName),
+		TableName:         aws.String(p.tableName),
+		ExclusiveStartKey: p.startKey,
 	}
-	result, err := dynamoDBClient.Scan(input)
+	if p.limit > 0 {
+		input.Limit = aws.Int32(p.limit)
+	}
+	result, err := s.Client.Scan(ctx, input)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"error": err.Error(),
 		}).Error("Failed to scan DynamoDB")
-		return nil, err
+		return nil, nil, err
 	}
 
 	// Marshal dynamodb contents
 	obj := []Item{}
-	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &obj)
+	err = attributevalue.UnmarshalListOfMaps(result.Items, &obj)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"error": err.Error(),
 		}).Error("Failed to unmarshal DynamoDB record")
-		return nil, err
+		return nil, nil, err
 	}
-	return obj, nil
+	return obj, result.LastEvaluatedKey, nil
 }
 
-// DynamoDBQuery returns contents of table by specified name or active status and performs a query returning json output
-func (s *Server) DynamoDBQuery(dynamoDBClient *dynamodb.DynamoDB) (contents []Item, dynamoError error) {
+// DynamoDBQuery returns a page of the table's contents filtered by name or
+// active status. The returned lastEvaluatedKey is non-nil when more pages
+// remain; pass it back as queryParams.startKey to resume from there.
+func (s *Server) DynamoDBQuery(ctx context.Context, p queryParams) (contents []Item, lastEvaluatedKey map[string]types.AttributeValue, dynamoError error) {
 	// build condition filter
 	var filt expression.ConditionBuilder
 
 	// set active true or false if needed
-	if s.status != "" {
+	if p.status != "" {
 		switch {
-		case s.status == "active":
-			s.active = true
-		case s.status == "inactive":
-			s.active = false
+		case p.status == "active":
+			p.active = true
+		case p.status == "inactive":
+			p.active = false
 		}
 	}
 
@@ -89,14 +154,14 @@ func (s *Server) DynamoDBQuery(dynamoDBClient *dynamodb.DynamoDB) (contents []It
 	var err error
 
 	// Build the condition filter for name and active status
-	if s.name != "" && s.status != "" {
-		filt = expression.Name("name").Equal(expression.Value(s.name)).And(expression.Name("active").Equal(expression.Value(s.active)))
+	if p.name != "" && p.status != "" {
+		filt = expression.Name("name").Equal(expression.Value(p.name)).And(expression.Name("active").Equal(expression.Value(p.active)))
 	} else {
 		// Build the filter for either name or active status
-		if s.name != "" && s.status == "" {
-			filt = expression.Name("name").Equal(expression.Value(s.name)) // Only query by name
-		} else if s.name == "" && s.status != "" {
-			filt = expression.Name("active").Equal(expression.Value(s.active)) // Only Query by active status
+		if p.name != "" && p.status == "" {
+			filt = expression.Name("name").Equal(expression.Value(p.name)) // Only query by name
+		} else if p.name == "" && p.status != "" {
+			filt = expression.Name("active").Equal(expression.Value(p.active)) // Only Query by active status
 		}
 	}
 	// Use expression package to build
@@ -113,26 +178,31 @@ func (s *Server) DynamoDBQuery(dynamoDBClient *dynamodb.DynamoDB) (contents []It
 		ExpressionAttributeValues: expr.Values(),
 		FilterExpression:          expr.Filter(),
 		ProjectionExpression:      expr.Projection(),
-		TableName:                 aws.String(s.tableName),
+		TableName:                 aws.String(p.tableName),
+		ExclusiveStartKey:         p.startKey,
+	}
+	if p.limit > 0 {
+		params.Limit = aws.Int32(p.limit)
 	}
 
 	obj := []Item{}
 	// make the DynamoDB Scan API call
-	result, err := dynamoDBClient.Scan(params)
+	result, err := s.Client.Scan(ctx, params)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"error": err.Error(),
 		}).Error("Query API call failed")
+		return nil, nil, err
 	}
 	// unmarshalling
-	err = dynamodbattribute.UnmarshalListOfMaps(result.Items, &obj)
+	err = attributevalue.UnmarshalListOfMaps(result.Items, &obj)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"error": err.Error(),
 		}).Error("Failed to unmarshal query output")
-		return nil, err
+		return nil, nil, err
 	}
-	return obj, nil
+	return obj, result.LastEvaluatedKey, nil
 }
 
 // ListHandler reaches out to DynamoDBList and DynamoDBQuery via the /list endpoint
@@ -147,39 +217,55 @@ func (s *Server) ListHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// create dynamoClient and pass in params
-	dynamoDBClient := dynamodb.New(s.ASess)
-
-	// reset current server params
-	s.tableName = ""
-	s.name = ""
-	s.status = ""
-	s.active = false
+	ctx := r.Context()
 
 	// access required param1, tableName
-	param1 := r.URL.Query().Get("tableName")
-	s.tableName = param1
+	tableName := r.URL.Query().Get("tableName")
 
 	// access optional param2, name
-	param2 := r.URL.Query().Get("name")
-	if param2 != "" {
-		s.name = param2
-	}
+	name := r.URL.Query().Get("name")
 
 	// access optional param3, active status
-	param3 := r.URL.Query().Get("status")
+	status := r.URL.Query().Get("status")
 
 	// set active status based on active/inactive keywords, no filter for "both" or "all"
-	if param3 == "active" || param3 == "inactive" {
-		s.status = param3
+	if status != "active" && status != "inactive" {
+		status = ""
+	}
+
+	// access optional pagination params
+	limit, err := parseLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		http.Error(w, "400 bad request: invalid limit.", http.StatusBadRequest)
+		return
+	}
+	startKey, err := decodeStartKey(r.URL.Query().Get("startKey"))
+	if err != nil {
+		http.Error(w, "400 bad request: invalid startKey.", http.StatusBadRequest)
+		return
+	}
+
+	// stream large tables element-by-element instead of buffering into memory
+	if r.URL.Query().Get("stream") == "true" {
+		s.streamList(ctx, w, tableName)
+		return
 	}
 
 	// list or query request
-	var resp []Item
-	if s.name != "" || s.status != "" {
-		resp, _ = s.DynamoDBQuery(dynamoDBClient)
+	var items []Item
+	var lastEvaluatedKey map[string]types.AttributeValue
+	if name != "" || status != "" {
+		items, lastEvaluatedKey, _ = s.DynamoDBQuery(ctx, queryParams{tableName: tableName, name: name, status: status, limit: limit, startKey: startKey})
 	} else { // otherwise just list table contents
-		resp, _ = s.DynamoDBList(dynamoDBClient)
+		items, lastEvaluatedKey, _ = s.DynamoDBList(ctx, listParams{tableName: tableName, limit: limit, startKey: startKey})
+	}
+
+	resp := ListResponse{Items: items}
+	resp.LastEvaluatedKey, err = encodeStartKey(lastEvaluatedKey)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to encode LastEvaluatedKey")
 	}
 
 	// marshal response and make it pretty
@@ -194,66 +280,100 @@ func (s *Server) ListHandler(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, string(respJSON))
 }
 
-// DyanmoDBGetItem is a helper method that returns the existing item on the table based on index
-func (s *Server) DynamoDBGetItem(dynamoDBClient *dynamodb.DynamoDB) (item Item) {
-	result, err := dynamoDBClient.GetItem(&dynamodb.GetItemInput{
-		TableName: aws.String(s.tableName),
-		Key: map[string]*dynamodb.AttributeValue{
-			"index": {
-				B: s.index,
-			},
-		},
+// DynamoDBGetItem is a helper method that returns the existing item on the table based on its primary key
+func (s *Server) DynamoDBGetItem(ctx context.Context, p getItemParams) (item Item, dynamoError error) {
+	key, err := s.buildKey(p.tableName, p.keyValues)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to build key for DynamoDBGetItem")
+		return Item{}, err
+	}
+
+	result, err := s.Client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(p.tableName),
+		Key:       key,
 	})
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"error": err.Error(),
 		}).Error("Failed to call DynamoDBGetItem")
+		return Item{}, err
 	}
 	item = Item{}
-	err = dynamodbattribute.UnmarshalMap(result.Item, &item)
+	err = attributevalue.UnmarshalMap(result.Item, &item)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"error": err.Error(),
 		}).Error("Failed to unmarshal GetItem response")
+		return Item{}, err
 	}
-	return item
+	return item, nil
 }
 
-// DynamoDBDeactivate deactivates the entry with the specified name in the table
-func (s *Server) DynamoDBDeactivate(dynamoDBClient *dynamodb.DynamoDB) (result Item) {
+// DynamoDBDeactivate atomically deactivates the entry with the specified
+// primary key, in a single UpdateItem guarded by a ConditionExpression:
+// the item must currently be active, and — when p.expectedVersion is set —
+// must still be at that version. DynamoDB rejects the update with a
+// *types.ConditionalCheckFailedException if either no longer holds, so
+// there's no read-then-write window for two deactivates to race. Every
+// successful deactivate also bumps a version attribute, even for callers
+// that don't pass If-Match. PutItemHandler and UpdateItemHandler do not
+// increment version.
+func (s *Server) DynamoDBDeactivate(ctx context.Context, p deactivateParams) (result Item, dynamoError error) {
 	log.Println("Entering DynamoDBDeactivate")
-	// Build the updateItem input based on active as an attribute value
-	input := &dynamodb.UpdateItemInput{
-		TableName: aws.String(s.tableName),
-		Key: map[string]*dynamodb.AttributeValue{
-			"index": {
-				B: s.index,
-			},
-		},
-		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
-			":active": {
-				BOOL: aws.Bool(false),
-			},
-		},
-		UpdateExpression: aws.String("set active = :active"), // set active status to false
-		ReturnValues:     aws.String("ALL_NEW"),
+
+	key, err := s.buildKey(p.tableName, p.keyValues)
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to build key for DynamoDBDeactivate")
+		return Item{}, err
 	}
-	var err error
-	resp, err := dynamoDBClient.UpdateItem(input)
+
+	update := expression.Set(expression.Name("active"), expression.Value(false)).
+		Set(expression.Name("version"), expression.Plus(expression.IfNotExists(expression.Name("version"), expression.Value(0)), expression.Value(1)))
+
+	cond := expression.Name("active").Equal(expression.Value(true))
+	if p.expectedVersion != nil {
+		cond = cond.And(expression.Name("version").Equal(expression.Value(*p.expectedVersion)))
+	}
+
+	expr, err := expression.NewBuilder().WithUpdate(update).WithCondition(cond).Build()
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"error": err.Error(),
-		}).Error("Failed to call UpdateItem")
-		return
+		}).Error("Got error building deactivate expression")
+		return Item{}, err
 	}
-	err = dynamodbattribute.UnmarshalMap(resp.Attributes, &result)
+
+	input := &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(p.tableName),
+		Key:                       key,
+		ConditionExpression:       expr.Condition(),
+		ExpressionAttributeNames:  expr.Names(),
+		ExpressionAttributeValues: expr.Values(),
+		UpdateExpression:          expr.Update(),
+		ReturnValues:              types.ReturnValueAllNew,
+	}
+	resp, err := s.Client.UpdateItem(ctx, input)
+	if err != nil {
+		var ccfe *types.ConditionalCheckFailedException
+		if !errors.As(err, &ccfe) {
+			logrus.WithFields(logrus.Fields{
+				"error": err.Error(),
+			}).Error("Failed to call UpdateItem")
+		}
+		return Item{}, err
+	}
+	err = attributevalue.UnmarshalMap(resp.Attributes, &result)
 	if err != nil {
 		logrus.WithFields(logrus.Fields{
 			"error": err.Error(),
 		}).Error("Failed to unmarshal in DynamoDBDeactivate")
-		return
+		return Item{}, err
 	}
-	return result
+	return result, nil
 }
 
 // DeactivateHandler reaches out to DynamoDBDeactivate via the /deactivate endpoint
@@ -268,72 +388,61 @@ func (s *Server) DeactivateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create dynamoClient and pass in params
-	dynamoDBClient := dynamodb.New(s.ASess)
-
-	// Reset current server params
-	s.tableName = ""
-	s.index = nil
+	ctx := r.Context()
 
 	// Access required param1, tableName
-	param1 := r.URL.Query().Get("tableName")
-	s.tableName = param1
+	tableName := r.URL.Query().Get("tableName")
 
-	// access param2, index
+	// access param2, the partition key's raw value
 	param2 := r.URL.Query().Get("index")
 	log.Println(param2)
 
-	if param2 != "" {
-		// Convert the string index that is passed in into a byte
-		indexJson, err := json.Marshal(param2)
+	if param2 == "" {
+		return
+	}
+
+	// Build the key values from raw query params using the table's
+	// registered KeySchema (falls back to the legacy binary "index" key)
+	schema := s.schemaFor(tableName)
+	keyValues := map[string]string{schema.PartitionKey.Name: param2}
+	if schema.SortKey != nil {
+		keyValues[schema.SortKey.Name] = r.URL.Query().Get("sortKey")
+	}
+
+	params := deactivateParams{tableName: tableName, keyValues: keyValues}
+
+	// An If-Match header pins the deactivate to a specific version, giving
+	// full optimistic concurrency control instead of just the active-only check
+	if ifMatch := r.Header.Get("If-Match"); ifMatch != "" {
+		version, err := strconv.ParseInt(ifMatch, 10, 64)
 		if err != nil {
-			logrus.WithFields(logrus.Fields{
-				"error": err.Error(),
-			}).Error("Failed to marshal index param")
-			return
-		}
-		var indexByte []byte
-		err6 := json.Unmarshal(indexJson, &indexByte)
-		if err6 != nil {
-			logrus.WithFields(logrus.Fields{
-				"error": err.Error(),
-			}).Error("Failed to unmarshal index param")
+			http.Error(w, "400 bad request: invalid If-Match version.", http.StatusBadRequest)
 			return
 		}
+		params.expectedVersion = &version
+	}
 
-		// Set index for all calls to server
-		s.index = indexByte
-
-		// Make a check for whether the entry is already inactive
-		currEntry := s.DynamoDBGetItem(dynamoDBClient)
-		if !currEntry.Active {
-			log.Print("Current entry is already inactive.")
-			// Get and format the current response
-			currEntryJSON, err := json.MarshalIndent(currEntry, "", "    ")
-			if err != nil {
-				logrus.WithFields(logrus.Fields{
-					"error": err.Error(),
-				}).Error("Failed to marshal in DynamoDBGetItem")
-				return
-			}
-			fmt.Fprint(w, "The deactivate request failed: Specified entry is already inactive \n", string(currEntryJSON))
-
-		} else {
-			fmt.Print("Current entry is active.")
-			// Make the call to deactivate
-			resp := s.DynamoDBDeactivate(dynamoDBClient)
-			log.Println(resp)
-
-			// Get and format the deactivated entry
-			respJSON, err := json.MarshalIndent(resp, "", "    ")
-			if err != nil {
-				logrus.WithFields(logrus.Fields{
-					"error": err.Error(),
-				}).Error("Failed to marshal output for the deactivate entry")
-				return
-			}
-			fmt.Fprint(w, "Successfully deactivated the specified entry, setting active status to false: \n", string(respJSON))
+	// Make the call to deactivate; DynamoDB rejects it atomically if the
+	// entry is already inactive or (with If-Match) at the wrong version
+	resp, err := s.DynamoDBDeactivate(ctx, params)
+	if err != nil {
+		var ccfe *types.ConditionalCheckFailedException
+		if errors.As(err, &ccfe) {
+			http.Error(w, "409 conflict: entry is already inactive or If-Match version is stale.", http.StatusConflict)
+			return
 		}
+		http.Error(w, "500 internal server error.", http.StatusInternalServerError)
+		return
+	}
+	log.Println(resp)
 
+	// Get and format the deactivated entry
+	respJSON, err := json.MarshalIndent(resp, "", "    ")
+	if err != nil {
+		logrus.WithFields(logrus.Fields{
+			"error": err.Error(),
+		}).Error("Failed to marshal output for the deactivate entry")
+		return
 	}
+	fmt.Fprint(w, "Successfully deactivated the specified entry, setting active status to false: \n", string(respJSON))
 }
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// fakeDynamoDBClient is a minimal DynamoDBAPI implementation for tests; every
+// call succeeds with a canned response: Scan returns no items, GetItem an
+// active item, UpdateItem an inactive one, and the rest empty outputs.
+type fakeDynamoDBClient struct{}
+
+func (f *fakeDynamoDBClient) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return &dynamodb.ScanOutput{Items: []map[string]types.AttributeValue{}}, nil
+}
+
+func (f *fakeDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{
+		Item: map[string]types.AttributeValue{
+			"active": &types.AttributeValueMemberBOOL{Value: true},
+		},
+	}, nil
+}
+
+func (f *fakeDynamoDBClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	return &dynamodb.UpdateItemOutput{
+		Attributes: map[string]types.AttributeValue{
+			"active": &types.AttributeValueMemberBOOL{Value: false},
+		},
+	}, nil
+}
+
+func (f *fakeDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDBClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func (f *fakeDynamoDBClient) CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	return &dynamodb.CreateTableOutput{}, nil
+}
+
+func (f *fakeDynamoDBClient) ListTables(ctx context.Context, params *dynamodb.ListTablesInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTablesOutput, error) {
+	return &dynamodb.ListTablesOutput{}, nil
+}
+
+// erroringDynamoDBClient fails every call with errBoom, to exercise the
+// error paths fakeDynamoDBClient's always-succeeding responses can't reach.
+type erroringDynamoDBClient struct{}
+
+var errBoom = errors.New("boom")
+
+func (e *erroringDynamoDBClient) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return nil, errBoom
+}
+
+func (e *erroringDynamoDBClient) GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error) {
+	return nil, errBoom
+}
+
+func (e *erroringDynamoDBClient) UpdateItem(ctx context.Context, params *dynamodb.UpdateItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.UpdateItemOutput, error) {
+	return nil, errBoom
+}
+
+func (e *erroringDynamoDBClient) PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	return nil, errBoom
+}
+
+func (e *erroringDynamoDBClient) DeleteItem(ctx context.Context, params *dynamodb.DeleteItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.DeleteItemOutput, error) {
+	return nil, errBoom
+}
+
+func (e *erroringDynamoDBClient) CreateTable(ctx context.Context, params *dynamodb.CreateTableInput, optFns ...func(*dynamodb.Options)) (*dynamodb.CreateTableOutput, error) {
+	return nil, errBoom
+}
+
+func (e *erroringDynamoDBClient) ListTables(ctx context.Context, params *dynamodb.ListTablesInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ListTablesOutput, error) {
+	return nil, errBoom
+}
+
+// TestDynamoDBGetItemReturnsErrorOnClientFailure guards against a
+// nil-pointer panic on result.Item: aws-sdk-go-v2 returns a nil output on
+// error (unlike v1, which always returns a zero-valued one), so the error
+// path must return before touching result.
+func TestDynamoDBGetItemReturnsErrorOnClientFailure(t *testing.T) {
+	s := &Server{Client: &erroringDynamoDBClient{}}
+	if _, err := s.DynamoDBGetItem(context.Background(), getItemParams{tableName: "table-a", keyValues: map[string]string{"index": "abc"}}); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+// TestDynamoDBQueryReturnsErrorOnClientFailure is DynamoDBQuery's analogue
+// of TestDynamoDBGetItemReturnsErrorOnClientFailure, guarding the Scan
+// error path the same way.
+func TestDynamoDBQueryReturnsErrorOnClientFailure(t *testing.T) {
+	s := &Server{Client: &erroringDynamoDBClient{}}
+	if _, _, err := s.DynamoDBQuery(context.Background(), queryParams{tableName: "table-a", name: "foo"}); err == nil {
+		t.Fatal("expected an error, got nil")
+	}
+}
+
+// TestItemMarshalsLowercaseIndex guards against a mismatch between the
+// attribute name Item's partition key maps to and the lowercase "index"
+// attribute of the default key schema CreateTableHandler declares: without
+// dynamodbav tags, MarshalMap would use the capitalized Go field name
+// "Index" instead, so a marshaled Item would be missing its key.
+func TestItemMarshalsLowercaseIndex(t *testing.T) {
+	av, err := attributevalue.MarshalMap(Item{Index: []byte("abc")})
+	if err != nil {
+		t.Fatalf("MarshalMap returned error: %v", err)
+	}
+	if _, ok := av["index"]; !ok {
+		t.Fatalf("expected marshaled item to have an \"index\" attribute, got %v", av)
+	}
+}
+
+// TestDynamoDBDeactivateBuildsUpdateExpression exercises the conditional
+// UpdateItem expression built by DynamoDBDeactivate, guarding against
+// expression-builder API misuse (e.g. calling a method that doesn't exist
+// on the builder type) that only surfaces at compile time.
+func TestDynamoDBDeactivateBuildsUpdateExpression(t *testing.T) {
+	s := &Server{Client: &fakeDynamoDBClient{}}
+
+	result, err := s.DynamoDBDeactivate(context.Background(), deactivateParams{
+		tableName: "table-a",
+		keyValues: map[string]string{"index": "abc"},
+	})
+	if err != nil {
+		t.Fatalf("DynamoDBDeactivate returned error: %v", err)
+	}
+	if result.Active {
+		t.Fatalf("expected deactivated item to have Active=false, got %+v", result)
+	}
+}
+
+// TestConcurrentListAndDeactivateNoRace hammers /list and /deactivate on a
+// single shared *Server concurrently. It exists to prove request params no
+// longer live on Server itself; run with `go test -race` to catch
+// regressions.
+func TestConcurrentListAndDeactivateNoRace(t *testing.T) {
+	s := &Server{Client: &fakeDynamoDBClient{}}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodGet, "/list?tableName=table-a&name=foo", nil)
+			w := httptest.NewRecorder()
+			s.ListHandler(w, req)
+		}()
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/deactivate?tableName=table-b&index=abc", nil)
+			w := httptest.NewRecorder()
+			s.DeactivateHandler(w, req)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,153 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// ChangeType describes how an item differed between two successive scans.
+type ChangeType string
+
+const (
+	ChangeInsert ChangeType = "insert"
+	ChangeUpdate ChangeType = "update"
+	ChangeDelete ChangeType = "delete"
+)
+
+// Change is pushed onto a Watcher's Changes channel whenever the polled
+// table differs from the previous scan.
+type Change struct {
+	Type ChangeType
+	Item Item
+}
+
+// Watcher periodically scans a table and reports the items that changed
+// since the previous scan. Stop must be called to release its goroutine.
+type Watcher struct {
+	Changes chan Change
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Stop cancels the scan loop and waits for it to exit.
+func (w *Watcher) Stop() {
+	w.cancel()
+	<-w.done
+}
+
+// StartWatcher scans tableName once every interval and pushes
+// inserts, updates, and deletes onto the returned Watcher's Changes
+// channel. A failed scan is retried with exponential backoff (capped to
+// the interval) rather than killing the poller, so a transient DynamoDB
+// error doesn't stop future scans.
+func (s *Server) StartWatcher(ctx context.Context, tableName string, interval time.Duration) *Watcher {
+	ctx, cancel := context.WithCancel(ctx)
+	w := &Watcher{
+		Changes: make(chan Change),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go s.runWatcher(ctx, w, tableName, interval)
+	return w
+}
+
+func (s *Server) runWatcher(ctx context.Context, w *Watcher, tableName string, interval time.Duration) {
+	defer close(w.done)
+	defer close(w.Changes)
+
+	seen := map[string]Item{}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			bo := backoff.NewExponentialBackOff()
+			bo.MaxElapsedTime = interval
+
+			err := backoff.Retry(func() error {
+				items, _, err := s.DynamoDBList(ctx, listParams{tableName: tableName})
+				if err != nil {
+					return err
+				}
+				emitChanges(ctx, w, seen, items)
+				return nil
+			}, backoff.WithContext(bo, ctx))
+			if err != nil {
+				logrus.WithFields(logrus.Fields{
+					"error": err.Error(),
+					"table": tableName,
+				}).Error("Watcher scan failed after retries")
+			}
+		}
+	}
+}
+
+// emitChanges diffs items against seen, sends a Change for every insert,
+// update, and delete, and updates seen in place to reflect the new scan.
+// Each send is select'd against ctx.Done(), so a caller that stops draining
+// Changes and cancels the watcher can't block this goroutine (and, in
+// turn, Stop) forever.
+func emitChanges(ctx context.Context, w *Watcher, seen map[string]Item, items []Item) {
+	current := make(map[string]struct{}, len(items))
+
+	for _, item := range items {
+		key := string(item.Index)
+		current[key] = struct{}{}
+
+		prev, ok := seen[key]
+		switch {
+		case !ok:
+			if !sendChange(ctx, w, Change{Type: ChangeInsert, Item: item}) {
+				return
+			}
+		case !itemsEqual(prev, item):
+			if !sendChange(ctx, w, Change{Type: ChangeUpdate, Item: item}) {
+				return
+			}
+		}
+		seen[key] = item
+	}
+
+	for key, item := range seen {
+		if _, ok := current[key]; !ok {
+			if !sendChange(ctx, w, Change{Type: ChangeDelete, Item: item}) {
+				return
+			}
+			delete(seen, key)
+		}
+	}
+}
+
+// sendChange sends change on w.Changes, reporting false instead of blocking
+// forever if ctx is done before anyone reads it.
+func sendChange(ctx context.Context, w *Watcher, change Change) bool {
+	select {
+	case w.Changes <- change:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func itemsEqual(a, b Item) bool {
+	if a.Name != b.Name || a.Active != b.Active || a.Version != b.Version || !bytes.Equal(a.Index, b.Index) {
+		return false
+	}
+	if len(a.Users) != len(b.Users) {
+		return false
+	}
+	for i := range a.Users {
+		if a.Users[i] != b.Users[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// watcherTestClient returns one item from Scan, so the first tick always
+// produces a Change.
+type watcherTestClient struct {
+	fakeDynamoDBClient
+}
+
+func (c *watcherTestClient) Scan(ctx context.Context, params *dynamodb.ScanInput, optFns ...func(*dynamodb.Options)) (*dynamodb.ScanOutput, error) {
+	return &dynamodb.ScanOutput{
+		Items: []map[string]types.AttributeValue{
+			{"index": &types.AttributeValueMemberB{Value: []byte("abc")}},
+		},
+	}, nil
+}
+
+// TestWatcherStopDoesNotHangWithoutDrainingChanges guards against
+// emitChanges blocking forever on an unbuffered, unselected channel send:
+// Stop must return promptly even if the caller never reads Changes.
+func TestWatcherStopDoesNotHangWithoutDrainingChanges(t *testing.T) {
+	s := &Server{Client: &watcherTestClient{}}
+	w := s.StartWatcher(context.Background(), "table-a", 10*time.Millisecond)
+
+	time.Sleep(50 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		w.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop() did not return within 1s; watcher goroutine is likely blocked on an unread Changes send")
+	}
+}